@@ -0,0 +1,59 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package mfs
+
+// blockCache is a small fixed-size LRU cache of recently read allocation
+// blocks. It exists to amortize the cost of callers that probe the same
+// block repeatedly, such as reading a resource fork header before deciding
+// whether to parse the rest of the fork.
+type blockCache struct {
+	capacity int
+	order    []uint16
+	blocks   map[uint16][]byte
+}
+
+func newBlockCache(capacity int) *blockCache {
+	return &blockCache{
+		capacity: capacity,
+		blocks:   make(map[uint16][]byte, capacity),
+	}
+}
+
+func (c *blockCache) get(index uint16) ([]byte, bool) {
+	data, ok := c.blocks[index]
+	if ok {
+		c.touch(index)
+	}
+	return data, ok
+}
+
+func (c *blockCache) put(index uint16, data []byte) {
+	if _, exists := c.blocks[index]; !exists && len(c.blocks) >= c.capacity {
+		c.evictOldest()
+	}
+
+	c.blocks[index] = data
+	c.touch(index)
+}
+
+func (c *blockCache) touch(index uint16) {
+	for i, v := range c.order {
+		if v == index {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	c.order = append(c.order, index)
+}
+
+func (c *blockCache) evictOldest() {
+	if len(c.order) == 0 {
+		return
+	}
+
+	oldest := c.order[0]
+	c.order = c.order[1:]
+	delete(c.blocks, oldest)
+}
@@ -0,0 +1,76 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+// Command mfsdump exports the files on an MFS volume to the host
+// filesystem, or streams them to stdout as a tar of MacBinary entries.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/st3fan/diskcopy"
+	"github.com/st3fan/mfs"
+)
+
+func main() {
+	format := flag.String("format", "macbinary", "export format: macbinary or appledouble")
+	outDir := flag.String("o", ".", "output directory")
+	tarOut := flag.Bool("tar", false, "stream a tar of MacBinary entries to stdout instead of writing to -o")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: mfsdump [-format macbinary|appledouble] [-o dir] [-tar] <image>")
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	image, err := diskcopy.NewImage(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	volume, err := mfs.NewVolume(image)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *tarOut {
+		if err := mfs.ExportTar(volume, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	exportFormat, err := parseFormat(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := mfs.Export(volume, *outDir, exportFormat); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func parseFormat(s string) (mfs.ExportFormat, error) {
+	switch s {
+	case "macbinary":
+		return mfs.MacBinary, nil
+	case "appledouble":
+		return mfs.AppleDouble, nil
+	default:
+		return 0, fmt.Errorf("unknown export format %q", s)
+	}
+}
@@ -0,0 +1,348 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package mfs
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+)
+
+// ExportFormat selects the on-disk archive format used by Export.
+type ExportFormat int
+
+const (
+	// MacBinary writes each file as a single MacBinary II encoded file,
+	// combining the Finder metadata and both forks.
+	MacBinary ExportFormat = iota
+	// AppleDouble writes the data fork as a plain file and puts the
+	// Finder metadata and resource fork in a "._name" sidecar file.
+	AppleDouble
+)
+
+// appleDoubleEpoch is the AppleDouble/AppleSingle date epoch, January 1,
+// 2000, expressed as a Unix timestamp.
+const appleDoubleEpoch = 946684800
+
+// Export writes every file on volume to dir, preserving both forks and the
+// Finder metadata, using the given format.
+func Export(volume *Volume, dir string, format ExportFormat) error {
+	for fileIndex := range volume.Files {
+		var err error
+
+		switch format {
+		case MacBinary:
+			err = exportMacBinaryFile(volume, fileIndex, dir)
+		case AppleDouble:
+			err = exportAppleDoubleFile(volume, fileIndex, dir)
+		default:
+			err = fmt.Errorf("mfs: unknown export format %d", format)
+		}
+
+		if err != nil {
+			return fmt.Errorf("mfs: exporting %q: %w", volume.Files[fileIndex].Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ExportTar streams every file on volume to w as a tar archive of MacBinary
+// II encoded entries, one per file, named after the file's Pascal filename.
+// This mirrors the seaweedfs tar-dump convention of emitting self-contained
+// MacBinary entries rather than a directory tree with sidecars.
+func ExportTar(volume *Volume, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	for fileIndex := range volume.Files {
+		file := volume.Files[fileIndex]
+
+		data, err := macBinaryEncode(volume, fileIndex)
+		if err != nil {
+			return fmt.Errorf("mfs: exporting %q: %w", file.Name, err)
+		}
+
+		header := &tar.Header{
+			Name:    file.Name,
+			Size:    int64(len(data)),
+			Mode:    0644,
+			ModTime: file.Modified,
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func exportMacBinaryFile(volume *Volume, fileIndex int, dir string) error {
+	data, err := macBinaryEncode(volume, fileIndex)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, volume.Files[fileIndex].Name), data, 0644)
+}
+
+// padTo128 pads the length of a fork to the next 128-byte boundary, as
+// required by the MacBinary format.
+func padTo128(length int64) int64 {
+	if rem := length % 128; rem != 0 {
+		return length + (128 - rem)
+	}
+	return length
+}
+
+func macBinaryEncode(volume *Volume, fileIndex int) ([]byte, error) {
+	file := volume.Files[fileIndex]
+
+	dataFork, err := volume.OpenDataFork(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	dataForkBytes, err := ioutil.ReadAll(dataFork)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceFork, err := volume.OpenResourceFork(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceForkBytes, err := ioutil.ReadAll(resourceFork)
+	if err != nil {
+		return nil, err
+	}
+
+	header := newMacBinaryHeader(file)
+
+	headerBytes, err := header.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, headerBytes...)
+	out = append(out, dataForkBytes...)
+	out = append(out, make([]byte, padTo128(int64(len(dataForkBytes)))-int64(len(dataForkBytes)))...)
+	out = append(out, resourceForkBytes...)
+	out = append(out, make([]byte, padTo128(int64(len(resourceForkBytes)))-int64(len(resourceForkBytes)))...)
+
+	return out, nil
+}
+
+// macBinaryHeader is the 128-byte MacBinary II header. Field offsets follow
+// the MacBinary II spec exactly; binary.Size of this struct must be 128.
+type macBinaryHeader struct {
+	Version               byte
+	NameLength            byte
+	Name                  [63]byte
+	Type                  [4]byte
+	Creator               [4]byte
+	FinderFlags           byte
+	Zero1                 byte
+	VerticalPosition      uint16
+	HorizontalPosition    uint16
+	WindowOrFolderID      uint16
+	ProtectedFlag         byte
+	Zero2                 byte
+	DataForkLength        uint32
+	ResourceForkLength    uint32
+	CreationDate          uint32
+	ModificationDate      uint32
+	CommentLength         uint16
+	FinderFlags2          byte
+	Reserved              [14]byte
+	TotalFilesLength      uint32
+	SecondaryHeaderLength uint16
+	UploaderVersion       byte
+	DownloaderMinVersion  byte
+	CRC                   uint16
+	Reserved2             [2]byte
+}
+
+// macBinaryIIVersion marks both the uploading and minimum-required
+// MacBinary version as II, per the MacBinary II spec.
+const macBinaryIIVersion = 0x81
+
+func newMacBinaryHeader(file File) *macBinaryHeader {
+	h := &macBinaryHeader{
+		NameLength:           byte(len(file.Name)),
+		DataForkLength:       uint32(file.DataForkLength),
+		ResourceForkLength:   uint32(file.ResourceForkLength),
+		CreationDate:         uint32(file.Created.Unix() + macEpochOffset),
+		ModificationDate:     uint32(file.Modified.Unix() + macEpochOffset),
+		UploaderVersion:      macBinaryIIVersion,
+		DownloaderMinVersion: macBinaryIIVersion,
+	}
+
+	copy(h.Name[:], file.Name)
+	copy(h.Type[:], file.Type)
+	copy(h.Creator[:], file.Creator)
+
+	return h
+}
+
+func (h *macBinaryHeader) encode() ([]byte, error) {
+	buf := make([]byte, 128)
+
+	w := &sliceWriter{buf: buf}
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return nil, err
+	}
+
+	crc := crc16XModem(buf[0:124])
+	binary.BigEndian.PutUint16(buf[124:126], crc)
+
+	return buf, nil
+}
+
+// sliceWriter lets binary.Write fill a pre-sized buffer in place.
+type sliceWriter struct {
+	buf []byte
+	pos int
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	n := copy(w.buf[w.pos:], p)
+	w.pos += n
+	return n, nil
+}
+
+// crc16XModem computes the CRC-16/XMODEM checksum used by the MacBinary
+// header, as specified by the MacBinary II spec (polynomial 0x1021, no
+// reflection, initial value 0).
+func crc16XModem(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func exportAppleDoubleFile(volume *Volume, fileIndex int, dir string) error {
+	file := volume.Files[fileIndex]
+
+	dataFork, err := volume.OpenDataFork(fileIndex)
+	if err != nil {
+		return err
+	}
+
+	dataForkBytes, err := ioutil.ReadAll(dataFork)
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, file.Name), dataForkBytes, 0644); err != nil {
+		return err
+	}
+
+	resourceFork, err := volume.OpenResourceFork(fileIndex)
+	if err != nil {
+		return err
+	}
+
+	resourceForkBytes, err := ioutil.ReadAll(resourceFork)
+	if err != nil {
+		return err
+	}
+
+	sidecar, err := appleDoubleEncode(file, resourceForkBytes)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, "._"+file.Name), sidecar, 0644)
+}
+
+// appleDoubleEntry describes one of the fixed-size entries that follow the
+// AppleDouble header.
+type appleDoubleEntry struct {
+	ID     uint32
+	Offset uint32
+	Length uint32
+}
+
+const (
+	appleDoubleEntryResourceFork = 2
+	appleDoubleEntryFileDates    = 8
+	appleDoubleEntryFinderInfo   = 9
+)
+
+// appleDoubleEncode builds an AppleDouble v2 sidecar file carrying the
+// Finder info, file dates, and resource fork of file.
+func appleDoubleEncode(file File, resourceForkBytes []byte) ([]byte, error) {
+	const (
+		magic   = 0x00051607
+		version = 0x00020000
+
+		finderInfoLength = 32
+		fileDatesLength  = 16
+		numEntries       = 3
+		headerLength     = 4 + 4 + 16 + 2 + numEntries*12
+	)
+
+	finderInfoOffset := uint32(headerLength)
+	fileDatesOffset := finderInfoOffset + finderInfoLength
+	resourceForkOffset := fileDatesOffset + fileDatesLength
+
+	buf := make([]byte, resourceForkOffset+uint32(len(resourceForkBytes)))
+
+	binary.BigEndian.PutUint32(buf[0:4], magic)
+	binary.BigEndian.PutUint32(buf[4:8], version)
+	// bytes 8:24 are the filler, left zero for version 2.
+	binary.BigEndian.PutUint16(buf[24:26], numEntries)
+
+	entries := []appleDoubleEntry{
+		{ID: appleDoubleEntryFinderInfo, Offset: finderInfoOffset, Length: finderInfoLength},
+		{ID: appleDoubleEntryFileDates, Offset: fileDatesOffset, Length: fileDatesLength},
+		{ID: appleDoubleEntryResourceFork, Offset: resourceForkOffset, Length: uint32(len(resourceForkBytes))},
+	}
+
+	for i, entry := range entries {
+		off := 26 + i*12
+		binary.BigEndian.PutUint32(buf[off:off+4], entry.ID)
+		binary.BigEndian.PutUint32(buf[off+4:off+8], entry.Offset)
+		binary.BigEndian.PutUint32(buf[off+8:off+12], entry.Length)
+	}
+
+	copy(buf[finderInfoOffset:finderInfoOffset+4], file.Type)
+	copy(buf[finderInfoOffset+4:finderInfoOffset+8], file.Creator)
+
+	putAppleDoubleDate(buf[fileDatesOffset:fileDatesOffset+4], file.Created)
+	putAppleDoubleDate(buf[fileDatesOffset+4:fileDatesOffset+8], file.Modified)
+	putAppleDoubleDate(buf[fileDatesOffset+8:fileDatesOffset+12], time.Time{})
+	putAppleDoubleDate(buf[fileDatesOffset+12:fileDatesOffset+16], time.Time{})
+
+	copy(buf[resourceForkOffset:], resourceForkBytes)
+
+	return buf, nil
+}
+
+func putAppleDoubleDate(b []byte, t time.Time) {
+	if t.IsZero() {
+		binary.BigEndian.PutUint32(b, 0x80000000) // AppleDouble's "no date" sentinel
+		return
+	}
+	binary.BigEndian.PutUint32(b, uint32(int32(t.Unix()-appleDoubleEpoch)))
+}
@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package mfs
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	errInvalidWhence    = errors.New("mfs: invalid whence")
+	errNegativePosition = errors.New("mfs: negative position")
+)
+
+// forkReader is an io.ReadSeeker and io.ReaderAt over a fork's allocation
+// chain. Blocks are resolved once, up front, as a slice of block indices;
+// their contents are only fetched from the underlying image when a Read or
+// ReadAt actually touches them, so opening a fork never pays for more I/O or
+// allocation than the caller ends up using.
+type forkReader struct {
+	volume *Volume
+	blocks []uint16
+	length int64
+	pos    int64
+}
+
+var _ io.ReadSeeker = (*forkReader)(nil)
+var _ io.ReaderAt = (*forkReader)(nil)
+
+func (f *forkReader) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.pos)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *forkReader) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = f.pos + offset
+	case io.SeekEnd:
+		newPos = f.length + offset
+	default:
+		return 0, errInvalidWhence
+	}
+
+	if newPos < 0 {
+		return 0, errNegativePosition
+	}
+
+	f.pos = newPos
+	return f.pos, nil
+}
+
+func (f *forkReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errNegativePosition
+	}
+	if off >= f.length {
+		return 0, io.EOF
+	}
+
+	// A read cut short at the fork's logical length reports io.EOF, as
+	// io.ReaderAt requires whenever fewer than len(p) bytes are returned.
+	var eof error
+	if max := f.length - off; int64(len(p)) > max {
+		p = p[:max]
+		eof = io.EOF
+	}
+
+	blockSize := int64(f.volume.vi.SizeOfAllocationBlocks)
+
+	var n int
+	for len(p) > 0 {
+		blockIndex, intra := off/blockSize, off%blockSize
+
+		block, err := f.volume.readAllocationBlock(f.blocks[blockIndex])
+		if err != nil {
+			return n, err
+		}
+
+		copied := copy(p, block[intra:])
+		n += copied
+		off += int64(copied)
+		p = p[copied:]
+	}
+
+	return n, eof
+}
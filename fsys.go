@@ -0,0 +1,308 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package mfs
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// namedForkSuffix mirrors the macOS "..namedfork/rsrc" path convention for
+// addressing a file's resource fork through a path-based API.
+const namedForkSuffix = "/..namedfork/rsrc"
+
+var (
+	_ fs.FS        = (*Volume)(nil)
+	_ fs.ReadDirFS = (*Volume)(nil)
+	_ fs.StatFS    = (*Volume)(nil)
+)
+
+// FileSys is the value (not a pointer) returned by the Sys method of a
+// fs.FileInfo describing a file on an MFS volume, preserving the Finder
+// metadata that fs.FileInfo has no room for.
+type FileSys struct {
+	Type               string
+	Creator            string
+	DataForkLength     int64
+	ResourceForkLength int64
+}
+
+// Open implements fs.FS. MFS is flat, so the root directory "." lists every
+// file on the volume; a file's data fork is opened by name, and its
+// resource fork by appending "/..namedfork/rsrc" to that name.
+func (volume *Volume) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return volume.openRoot(forkData)
+	}
+
+	fileIndex, fork, err := volume.resolvePath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return volume.openFileFork(fileIndex, fork)
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (volume *Volume) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return volume.readDir(forkData), nil
+}
+
+func (volume *Volume) readDir(fork forkKind) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(volume.Files))
+	for i := range volume.Files {
+		// Root entries are named after the file, which is the name Open
+		// resolves in both the data and the resource fork view.
+		info := volume.fileInfo(i, fork)
+		info.name = volume.Files[i].Name
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+
+	// fs.ReadDirFS.ReadDir is documented to return entries sorted by filename.
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries
+}
+
+// Stat implements fs.StatFS.
+func (volume *Volume) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return rootFileInfo{}, nil
+	}
+
+	fileIndex, fork, err := volume.resolvePath(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return volume.fileInfo(fileIndex, fork), nil
+}
+
+// Sub returns a view of volume that presents the resource fork of each file
+// where Open would otherwise return the data fork, mirroring fs.Sub without
+// requiring a subdirectory to exist.
+func (volume *Volume) Sub(fork string) (fs.FS, error) {
+	if fork != "rsrc" {
+		return nil, &fs.PathError{Op: "sub", Path: fork, Err: fs.ErrInvalid}
+	}
+
+	return &forkFS{volume: volume}, nil
+}
+
+type forkKind int
+
+const (
+	forkData forkKind = iota
+	forkResource
+)
+
+func (volume *Volume) resolvePath(name string) (int, forkKind, error) {
+	fork := forkData
+
+	if strings.HasSuffix(name, namedForkSuffix) {
+		fork = forkResource
+		name = strings.TrimSuffix(name, namedForkSuffix)
+	}
+
+	for i := range volume.Files {
+		if volume.Files[i].Name == name {
+			return i, fork, nil
+		}
+	}
+
+	return 0, 0, fs.ErrNotExist
+}
+
+func (volume *Volume) openFileFork(fileIndex int, fork forkKind) (fs.File, error) {
+	var (
+		r   io.ReadSeeker
+		err error
+	)
+
+	switch fork {
+	case forkResource:
+		r, err = volume.OpenResourceFork(fileIndex)
+	default:
+		r, err = volume.OpenDataFork(fileIndex)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &openFile{r: r, info: volume.fileInfo(fileIndex, fork)}, nil
+}
+
+func (volume *Volume) openRoot(fork forkKind) (fs.File, error) {
+	return &rootDir{entries: volume.readDir(fork)}, nil
+}
+
+func (volume *Volume) fileInfo(fileIndex int, fork forkKind) fileInfo {
+	file := volume.Files[fileIndex]
+
+	name := file.Name
+	size := file.DataForkLength
+	if fork == forkResource {
+		// fs.FileInfo.Name is documented as the base name of the file;
+		// for the named-fork path convention that base name is "rsrc".
+		name = "rsrc"
+		size = file.ResourceForkLength
+	}
+
+	return fileInfo{
+		name:    name,
+		size:    size,
+		modTime: file.Modified,
+		sys: FileSys{
+			Type:               file.Type,
+			Creator:            file.Creator,
+			DataForkLength:     file.DataForkLength,
+			ResourceForkLength: file.ResourceForkLength,
+		},
+	}
+}
+
+// fileInfo implements fs.FileInfo and fs.DirEntry for a single file or
+// named fork.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	sys     FileSys
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) Mode() fs.FileMode  { return 0444 }
+func (fi fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi fileInfo) IsDir() bool        { return false }
+func (fi fileInfo) Sys() interface{}   { return fi.sys }
+
+// rootFileInfo describes the single, synthetic root directory of a volume.
+type rootFileInfo struct{}
+
+func (rootFileInfo) Name() string       { return "." }
+func (rootFileInfo) Size() int64        { return 0 }
+func (rootFileInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (rootFileInfo) ModTime() time.Time { return time.Time{} }
+func (rootFileInfo) IsDir() bool        { return true }
+func (rootFileInfo) Sys() interface{}   { return nil }
+
+// openFile adapts a fork's io.ReadSeeker to fs.File.
+type openFile struct {
+	r    io.ReadSeeker
+	info fileInfo
+}
+
+func (f *openFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *openFile) Close() error               { return nil }
+
+// Seek forwards to the wrapped fork reader so that callers depending on
+// io.Seeker (notably http.FileServer, for range requests) work against a
+// Volume opened through http.FS.
+func (f *openFile) Seek(offset int64, whence int) (int64, error) {
+	return f.r.Seek(offset, whence)
+}
+
+// rootDir is the fs.File returned for the synthetic root directory.
+type rootDir struct {
+	entries []fs.DirEntry
+	read    int
+}
+
+func (d *rootDir) Stat() (fs.FileInfo, error) { return rootFileInfo{}, nil }
+func (d *rootDir) Read([]byte) (int, error)   { return 0, &fs.PathError{Op: "read", Path: ".", Err: fs.ErrInvalid} }
+func (d *rootDir) Close() error               { return nil }
+
+func (d *rootDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 {
+		entries := d.entries[d.read:]
+		d.read = len(d.entries)
+		return entries, nil
+	}
+
+	remaining := len(d.entries) - d.read
+	if remaining == 0 {
+		return nil, io.EOF
+	}
+	if n > remaining {
+		n = remaining
+	}
+
+	entries := d.entries[d.read : d.read+n]
+	d.read += n
+	return entries, nil
+}
+
+// forkFS is the fs.FS returned by Volume.Sub("rsrc"); Open resolves names
+// against resource forks instead of data forks.
+type forkFS struct {
+	volume *Volume
+}
+
+var (
+	_ fs.FS        = (*forkFS)(nil)
+	_ fs.ReadDirFS = (*forkFS)(nil)
+	_ fs.StatFS    = (*forkFS)(nil)
+)
+
+func (f *forkFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return f.volume.openRoot(forkResource)
+	}
+
+	for i := range f.volume.Files {
+		if f.volume.Files[i].Name == name {
+			return f.volume.openFileFork(i, forkResource)
+		}
+	}
+
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (f *forkFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return f.volume.readDir(forkResource), nil
+}
+
+func (f *forkFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if name == "." {
+		return rootFileInfo{}, nil
+	}
+
+	for i := range f.volume.Files {
+		if f.volume.Files[i].Name == name {
+			return f.volume.fileInfo(i, forkResource), nil
+		}
+	}
+
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,68 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package mfs_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/st3fan/mfs"
+)
+
+func addTestdataSeeds(f *testing.F) {
+	matches, err := filepath.Glob("testdata/*")
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, path := range matches {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		f.Add(data)
+	}
+}
+
+// FuzzNewVolume exercises NewVolume directly against arbitrary bytes. The
+// parser trusts several length and count fields read straight from the
+// image, so this mainly checks that malformed input produces an error
+// instead of a panic.
+func FuzzNewVolume(f *testing.F) {
+	addTestdataSeeds(f)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		if _, err := mfs.NewVolume(bytes.NewReader(b)); err != nil {
+			return
+		}
+	})
+}
+
+// FuzzOpenForks goes one step further than FuzzNewVolume: for any image
+// that parses successfully, it also opens and fully reads both forks of
+// every file, which is what exercises the allocation chain walk.
+func FuzzOpenForks(f *testing.F) {
+	addTestdataSeeds(f)
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		volume, err := mfs.NewVolume(bytes.NewReader(b))
+		if err != nil {
+			return
+		}
+
+		for fileIndex := range volume.Files {
+			if r, err := volume.OpenDataFork(fileIndex); err == nil {
+				_, _ = io.Copy(io.Discard, r)
+			}
+
+			if r, err := volume.OpenResourceFork(fileIndex); err == nil {
+				_, _ = io.Copy(io.Discard, r)
+			}
+		}
+	})
+}
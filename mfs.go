@@ -5,10 +5,10 @@
 package mfs
 
 import (
-	"bytes"
 	"encoding/binary"
 	"errors"
 	"io"
+	"sync"
 	"time"
 )
 
@@ -16,6 +16,11 @@ const (
 	logicalBlockSize    = 512
 	maxFileNameLength   = 31 // Excluding the length byte
 	maxVolumeNameLength = 27 // Exluding the length byte
+
+	// macEpochOffset is the number of seconds between the Macintosh epoch
+	// (January 1, 1904) and the Unix epoch. CrDat/MdDat are seconds since
+	// the former; time.Time is seconds since the latter.
+	macEpochOffset = 2082844800
 )
 
 type volumeInformation struct {
@@ -54,6 +59,8 @@ type fileDirectoryEntry struct {
 // Volume represents an MFS volume.
 type Volume struct {
 	r                io.ReadSeeker
+	mu               sync.Mutex
+	blockCache       *blockCache
 	allocationBlocks []uint16
 	Name             string
 	Files            []File
@@ -73,10 +80,18 @@ type File struct {
 }
 
 func pascalString(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
 	length := int(data[0])
-	if length == 0 {
+	if length <= 0 {
 		return ""
 	}
+	if length > len(data)-1 {
+		length = len(data) - 1
+	}
+
 	return string(data[1 : length+1])
 }
 
@@ -103,6 +118,23 @@ func NewVolume(r io.ReadSeeker) (*Volume, error) {
 		return nil, errors.New("Invalid volume signature")
 	}
 
+	imageSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	if (int64(vi.DirSt)+int64(vi.BlLen))*logicalBlockSize > imageSize {
+		return nil, errors.New("mfs: directory or allocation block area extends past the end of the image")
+	}
+
+	if vi.SizeOfAllocationBlocks == 0 || vi.SizeOfAllocationBlocks%logicalBlockSize != 0 || int64(vi.SizeOfAllocationBlocks) > imageSize {
+		return nil, errors.New("mfs: invalid allocation block size")
+	}
+
+	if _, err := r.Seek(1024+int64(binary.Size(vi)), io.SeekStart); err != nil {
+		return nil, err
+	}
+
 	// Read the volume allocation block map
 
 	var t byte = 0
@@ -147,10 +179,14 @@ func NewVolume(r io.ReadSeeker) (*Volume, error) {
 			return nil, err
 		}
 
+		if int(fde.Nam[0]) > maxFileNameLength {
+			return nil, errors.New("mfs: corrupt directory entry: file name too long")
+		}
+
 		files = append(files, File{
 			Name:               pascalString(fde.Nam[:]),
-			Created:            time.Unix(int64(fde.CrDat)-2082844800, 0),
-			Modified:           time.Unix(int64(fde.MdDat)-2082844800, 0),
+			Created:            time.Unix(int64(fde.CrDat)-macEpochOffset, 0),
+			Modified:           time.Unix(int64(fde.MdDat)-macEpochOffset, 0),
 			Type:               string(fde.UsrWds[0:4]),
 			Creator:            string(fde.UsrWds[4:8]),
 			DataForkLength:     int64(fde.LgLen),
@@ -189,6 +225,7 @@ func NewVolume(r io.ReadSeeker) (*Volume, error) {
 
 	return &Volume{
 		r:                r,
+		blockCache:       newBlockCache(16),
 		allocationBlocks: allocationBlocks,
 		Name:             pascalString(vi.VolumeName[:]),
 		Files:            files,
@@ -196,8 +233,16 @@ func NewVolume(r io.ReadSeeker) (*Volume, error) {
 	}, nil
 }
 
+// readAllocationBlock reads allocation block allocationBlockIndex from the
+// underlying image. volume.r is shared by every fork reader opened on this
+// volume, so access to it is serialized with volume.mu.
 func (volume *Volume) readAllocationBlock(allocationBlockIndex uint16) ([]byte, error) {
-	//log.Printf("Reading allocation block %v", allocationBlockIndex)
+	volume.mu.Lock()
+	defer volume.mu.Unlock()
+
+	if data, ok := volume.blockCache.get(allocationBlockIndex); ok {
+		return data, nil
+	}
 
 	buffer := make([]byte, volume.vi.SizeOfAllocationBlocks)
 
@@ -208,47 +253,75 @@ func (volume *Volume) readAllocationBlock(allocationBlockIndex uint16) ([]byte,
 		return nil, err
 	}
 
-	if _, err := volume.r.Read(buffer); err != nil {
+	if _, err := io.ReadFull(volume.r, buffer); err != nil {
 		return nil, err
 	}
 
+	volume.blockCache.put(allocationBlockIndex, buffer)
+
 	return buffer, nil
 }
 
-func (volume *Volume) bytesReader(allocationBlockIndex uint16, length uint32) (io.Reader, error) {
-	data := []byte{}
+// resolveChain walks the allocation block map starting at allocationBlockIndex
+// and returns the ordered list of blocks that make up the fork, without
+// reading any of their data. The chain is terminated by the sentinel value 1.
+func (volume *Volume) resolveChain(allocationBlockIndex uint16, length uint32) ([]uint16, error) {
+	if length == 0 {
+		return nil, nil
+	}
 
-	if length != 0 {
-		allocationBlockData, err := volume.readAllocationBlock(allocationBlockIndex)
-		if err != nil {
-			return nil, err
+	var blocks []uint16
+	for allocationBlockIndex != 1 {
+		if int(allocationBlockIndex)-2 < 0 || int(allocationBlockIndex)-2 >= len(volume.allocationBlocks) {
+			return nil, errors.New("mfs: allocation block index out of range")
 		}
 
-		data = append(data, allocationBlockData...)
+		blocks = append(blocks, allocationBlockIndex)
 		allocationBlockIndex = volume.allocationBlocks[allocationBlockIndex-2]
 
-		for allocationBlockIndex != 1 {
-			allocationBlockData, err := volume.readAllocationBlock(allocationBlockIndex)
-			if err != nil {
-				return nil, err
-			}
-
-			data = append(data, allocationBlockData...)
-			allocationBlockIndex = volume.allocationBlocks[allocationBlockIndex-2]
+		if len(blocks) > len(volume.allocationBlocks) {
+			return nil, errors.New("mfs: allocation chain did not terminate")
 		}
 	}
 
-	return bytes.NewReader(data[0:length]), nil
+	return blocks, nil
 }
 
-// OpenDataFork returns a io.Reader for the file with the given index
-func (volume *Volume) OpenDataFork(fileIndex int) (io.Reader, error) {
+// OpenDataFork returns an io.ReadSeeker (also implementing io.ReaderAt) for
+// the data fork of the file with the given index. Allocation blocks are
+// fetched from the underlying image lazily, on demand, rather than being
+// buffered up front.
+func (volume *Volume) OpenDataFork(fileIndex int) (io.ReadSeeker, error) {
 	file := volume.Files[fileIndex]
-	return volume.bytesReader(file.directoryEntry.StBlk, file.directoryEntry.LgLen)
+	return volume.openFork(file.directoryEntry.StBlk, file.directoryEntry.LgLen)
 }
 
-// OpenResourceFork returns a io.Reader for the file with the given index
-func (volume *Volume) OpenResourceFork(fileIndex int) (io.Reader, error) {
+// OpenResourceFork returns an io.ReadSeeker (also implementing io.ReaderAt)
+// for the resource fork of the file with the given index. Allocation blocks
+// are fetched from the underlying image lazily, on demand, rather than being
+// buffered up front.
+func (volume *Volume) OpenResourceFork(fileIndex int) (io.ReadSeeker, error) {
 	file := volume.Files[fileIndex]
-	return volume.bytesReader(file.directoryEntry.RStBlk, file.directoryEntry.RLgLen)
+	return volume.openFork(file.directoryEntry.RStBlk, file.directoryEntry.RLgLen)
+}
+
+func (volume *Volume) openFork(allocationBlockIndex uint16, length uint32) (io.ReadSeeker, error) {
+	blocks, err := volume.resolveChain(allocationBlockIndex, length)
+	if err != nil {
+		return nil, err
+	}
+
+	// LgLen/RLgLen is read straight off disk and isn't guaranteed to match
+	// the amount of data the resolved chain actually covers; cap it so
+	// ReadAt never indexes past the end of blocks.
+	forkLength := int64(length)
+	if available := int64(len(blocks)) * int64(volume.vi.SizeOfAllocationBlocks); forkLength > available {
+		forkLength = available
+	}
+
+	return &forkReader{
+		volume: volume,
+		blocks: blocks,
+		length: forkLength,
+	}, nil
 }
@@ -0,0 +1,228 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+// Package resfork parses the classic Mac OS resource fork format: the
+// 16-byte fork header, the resource map with its type list and reference
+// lists, and the length-prefixed resource data itself. It gives callers a
+// typed way to enumerate resources such as CODE, ICN# or STR  without
+// hand-rolling binary.Read calls against the raw fork bytes.
+package resfork
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// OSType is a four character Macintosh resource type, e.g. "CODE" or "ICN#".
+type OSType string
+
+// header is the 16-byte resource fork header.
+type header struct {
+	DataOffset uint32
+	MapOffset  uint32
+	DataLength uint32
+	MapLength  uint32
+}
+
+// ResourceFork is a parsed resource fork. It holds on to the io.ReaderAt it
+// was built from and reads resource data lazily, on the first Read of a
+// reader returned by Resource.Open.
+type ResourceFork struct {
+	r      io.ReaderAt
+	h      header
+	types  []OSType
+	byType map[OSType][]*Resource
+}
+
+// Resource is a single entry in a resource fork's reference list.
+type Resource struct {
+	fork       *ResourceFork
+	typ        OSType
+	id         int16
+	name       string
+	attributes uint8
+	dataOffset uint32 // absolute offset of the resource's length-prefixed data
+}
+
+// New parses the resource fork exposed by r.
+func New(r io.ReaderAt) (*ResourceFork, error) {
+	var h header
+	if err := binary.Read(io.NewSectionReader(r, 0, 16), binary.BigEndian, &h); err != nil {
+		return nil, err
+	}
+
+	rf := &ResourceFork{
+		r:      r,
+		h:      h,
+		byType: make(map[OSType][]*Resource),
+	}
+
+	if err := rf.parseMap(); err != nil {
+		return nil, err
+	}
+
+	return rf, nil
+}
+
+// Types returns every resource type present in the fork.
+func (rf *ResourceFork) Types() []OSType {
+	return rf.types
+}
+
+// Resources returns the resources of the given type, in the order they
+// appear in the reference list.
+func (rf *ResourceFork) Resources(typ OSType) []*Resource {
+	return rf.byType[typ]
+}
+
+// ID returns the resource's ID.
+func (r *Resource) ID() int16 {
+	return r.id
+}
+
+// Name returns the resource's name, or the empty string if it has none.
+func (r *Resource) Name() string {
+	return r.name
+}
+
+// Attributes returns the resource's attribute byte.
+func (r *Resource) Attributes() uint8 {
+	return r.attributes
+}
+
+// Open returns a reader over the resource's data. The length-prefix is
+// parsed lazily, on the first Read, so opening a resource you never read
+// costs nothing beyond bookkeeping.
+func (r *Resource) Open() io.Reader {
+	return &resourceDataReader{r: r.fork.r, offset: int64(r.dataOffset)}
+}
+
+// resourceDataReader reads a single resource's data, skipping over the
+// 4-byte big-endian length that precedes it in the fork.
+type resourceDataReader struct {
+	r      io.ReaderAt
+	offset int64
+	sr     *io.SectionReader
+}
+
+func (rr *resourceDataReader) Read(p []byte) (int, error) {
+	if rr.sr == nil {
+		var length uint32
+		if err := binary.Read(io.NewSectionReader(rr.r, rr.offset, 4), binary.BigEndian, &length); err != nil {
+			return 0, err
+		}
+		rr.sr = io.NewSectionReader(rr.r, rr.offset+4, int64(length))
+	}
+
+	return rr.sr.Read(p)
+}
+
+// mapReservedSize is the 16-byte copy of the header, the 4-byte handle to
+// the next resource map, and the 2-byte file reference number that precede
+// the file attributes at the start of the resource map.
+const mapReservedSize = 16 + 4 + 2
+
+func (rf *ResourceFork) parseMap() error {
+	mapBase := int64(rf.h.MapOffset)
+
+	var fields struct {
+		Attributes     uint16
+		TypeListOffset uint16
+		NameListOffset uint16
+	}
+	if err := binary.Read(io.NewSectionReader(rf.r, mapBase+mapReservedSize, 6), binary.BigEndian, &fields); err != nil {
+		return err
+	}
+
+	typeListBase := mapBase + int64(fields.TypeListOffset)
+	nameListBase := mapBase + int64(fields.NameListOffset)
+
+	var typeCountMinusOne uint16
+	if err := binary.Read(io.NewSectionReader(rf.r, typeListBase, 2), binary.BigEndian, &typeCountMinusOne); err != nil {
+		return err
+	}
+
+	typeCount := int(typeCountMinusOne) + 1
+
+	for i := 0; i < typeCount; i++ {
+		var entry struct {
+			Type          [4]byte
+			CountMinusOne uint16
+			RefListOffset uint16
+		}
+		off := typeListBase + 2 + int64(i)*8
+		if err := binary.Read(io.NewSectionReader(rf.r, off, 8), binary.BigEndian, &entry); err != nil {
+			return err
+		}
+
+		typ := OSType(entry.Type[:])
+		rf.types = append(rf.types, typ)
+
+		refCount := int(entry.CountMinusOne) + 1
+		refListBase := typeListBase + int64(entry.RefListOffset)
+
+		resources, err := rf.parseReferenceList(typ, refListBase, refCount, nameListBase)
+		if err != nil {
+			return err
+		}
+
+		rf.byType[typ] = resources
+	}
+
+	return nil
+}
+
+func (rf *ResourceFork) parseReferenceList(typ OSType, base int64, count int, nameListBase int64) ([]*Resource, error) {
+	resources := make([]*Resource, 0, count)
+
+	for i := 0; i < count; i++ {
+		var entry struct {
+			ID             int16
+			NameOffset     int16
+			AttrAndDataOff uint32 // top byte is attributes, low 24 bits are the data offset
+			Reserved       uint32
+		}
+		off := base + int64(i)*12
+		if err := binary.Read(io.NewSectionReader(rf.r, off, 12), binary.BigEndian, &entry); err != nil {
+			return nil, err
+		}
+
+		name, err := rf.readName(nameListBase, entry.NameOffset)
+		if err != nil {
+			return nil, err
+		}
+
+		resources = append(resources, &Resource{
+			fork:       rf,
+			typ:        typ,
+			id:         entry.ID,
+			name:       name,
+			attributes: uint8(entry.AttrAndDataOff >> 24),
+			dataOffset: rf.h.DataOffset + (entry.AttrAndDataOff & 0x00ffffff),
+		})
+	}
+
+	return resources, nil
+}
+
+func (rf *ResourceFork) readName(nameListBase int64, nameOffset int16) (string, error) {
+	if nameOffset == -1 {
+		return "", nil
+	}
+
+	var length uint8
+	if err := binary.Read(io.NewSectionReader(rf.r, nameListBase+int64(nameOffset), 1), binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length == 0 {
+		return "", nil
+	}
+
+	buf := make([]byte, length)
+	if _, err := rf.r.ReadAt(buf, nameListBase+int64(nameOffset)+1); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
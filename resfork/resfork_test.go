@@ -0,0 +1,68 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package resfork_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/st3fan/diskcopy"
+	"github.com/st3fan/mfs"
+	"github.com/st3fan/mfs/resfork"
+)
+
+func resourceForkFromPath(path string, fileIndex int) (*resfork.ResourceFork, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := diskcopy.NewImage(file)
+	if err != nil {
+		return nil, err
+	}
+
+	volume, err := mfs.NewVolume(image)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := volume.OpenResourceFork(fileIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return resfork.New(r.(io.ReaderAt))
+}
+
+func Test_New(t *testing.T) {
+	rf, err := resourceForkFromPath("../testdata/VideoWorks Disk 1.image", 3)
+	if err != nil {
+		t.Error("Could not parse resource fork:", err)
+	}
+
+	if len(rf.Types()) == 0 {
+		t.Error("Expected at least one resource type")
+	}
+}
+
+func Test_OpenResource(t *testing.T) {
+	rf, err := resourceForkFromPath("../testdata/VideoWorks Disk 1.image", 3)
+	if err != nil {
+		t.Error("Could not parse resource fork:", err)
+	}
+
+	for _, typ := range rf.Types() {
+		for _, resource := range rf.Resources(typ) {
+			contents, err := ioutil.ReadAll(resource.Open())
+			if err != nil {
+				t.Errorf("Could not read resource %s %d: %v", typ, resource.ID(), err)
+			}
+			_ = contents
+		}
+	}
+}
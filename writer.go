@@ -0,0 +1,455 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package mfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+const (
+	// defaultVolumeSize is the size, in bytes, of a classic 400K
+	// single-sided floppy image (800 logical blocks of 512 bytes).
+	defaultVolumeSize = 800 * logicalBlockSize
+
+	// writerAllocationBlockSize is the allocation block size used for
+	// volumes created by this package, matching the value found on
+	// classic 400K floppies.
+	writerAllocationBlockSize = 1024
+
+	// directoryEntryFixedSize is the size, in bytes, of a
+	// fileDirectoryEntry up to and including MdDat, i.e. everything
+	// before the Pascal filename.
+	directoryEntryFixedSize = 50
+
+	// volumeInformationSize is the on-disk size of volumeInformation.
+	volumeInformationSize = 64
+)
+
+// chainEnd is the sentinel allocation block map value that marks the last
+// block of a file's fork.
+const chainEnd = 1
+
+// VolumeOptions configures a volume created with Create.
+type VolumeOptions struct {
+	// Name is the volume name, 1 to maxVolumeNameLength characters.
+	Name string
+
+	// TotalSize is the size, in bytes, of the image to write. If zero, it
+	// defaults to the size of a classic 400K floppy and grows as needed
+	// to fit the files that are added.
+	TotalSize int64
+}
+
+// FileMeta carries the Finder metadata for a file added with AddFile.
+type FileMeta struct {
+	Type     string
+	Creator  string
+	Created  time.Time
+	Modified time.Time
+}
+
+type pendingFile struct {
+	name string
+	meta FileMeta
+	data []byte
+	rsrc []byte
+}
+
+// VolumeWriter builds a new MFS volume. Create a VolumeWriter with Create,
+// add files with AddFile, then call Close to lay out and write the volume.
+type VolumeWriter struct {
+	w         io.WriteSeeker
+	name      string
+	totalSize int64
+	files     []pendingFile
+	closed    bool
+}
+
+// Create returns a VolumeWriter that writes a new MFS volume to w.
+func Create(w io.WriteSeeker, opts VolumeOptions) (*VolumeWriter, error) {
+	if len(opts.Name) == 0 || len(opts.Name) > maxVolumeNameLength {
+		return nil, errors.New("mfs: invalid volume name")
+	}
+
+	totalSize := opts.TotalSize
+	if totalSize == 0 {
+		totalSize = defaultVolumeSize
+	}
+
+	return &VolumeWriter{w: w, name: opts.Name, totalSize: totalSize}, nil
+}
+
+// AddFile adds a file to the volume, reading its data and resource fork
+// fully into memory. data and rsrc may be nil for an empty fork. A file
+// whose name matches one already added replaces it.
+func (vw *VolumeWriter) AddFile(name string, meta FileMeta, data, rsrc io.Reader) error {
+	if vw.closed {
+		return errors.New("mfs: volume writer is closed")
+	}
+	if len(name) == 0 || len(name) > maxFileNameLength {
+		return errors.New("mfs: invalid file name")
+	}
+
+	var dataBytes, rsrcBytes []byte
+	var err error
+
+	if data != nil {
+		if dataBytes, err = ioutil.ReadAll(data); err != nil {
+			return err
+		}
+	}
+	if rsrc != nil {
+		if rsrcBytes, err = ioutil.ReadAll(rsrc); err != nil {
+			return err
+		}
+	}
+
+	pf := pendingFile{name: name, meta: meta, data: dataBytes, rsrc: rsrcBytes}
+	for i := range vw.files {
+		if vw.files[i].name == name {
+			vw.files[i] = pf
+			return nil
+		}
+	}
+
+	vw.files = append(vw.files, pf)
+	return nil
+}
+
+// Writer returns a VolumeWriter seeded with every file already on volume,
+// so that it can be mutated (by calling AddFile for new or replacement
+// files) and rewritten with Close. w is typically the same image volume was
+// opened from, reopened for writing.
+func (volume *Volume) Writer(w io.WriteSeeker) (*VolumeWriter, error) {
+	vw, err := Create(w, VolumeOptions{Name: volume.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, file := range volume.Files {
+		data, err := volume.OpenDataFork(i)
+		if err != nil {
+			return nil, err
+		}
+		dataBytes, err := ioutil.ReadAll(data)
+		if err != nil {
+			return nil, err
+		}
+
+		rsrc, err := volume.OpenResourceFork(i)
+		if err != nil {
+			return nil, err
+		}
+		rsrcBytes, err := ioutil.ReadAll(rsrc)
+		if err != nil {
+			return nil, err
+		}
+
+		meta := FileMeta{Type: file.Type, Creator: file.Creator, Created: file.Created, Modified: file.Modified}
+		if err := vw.AddFile(file.Name, meta, bytes.NewReader(dataBytes), bytes.NewReader(rsrcBytes)); err != nil {
+			return nil, err
+		}
+	}
+
+	return vw, nil
+}
+
+// forkLayout describes where a fork's allocation chain starts and how many
+// blocks it occupies.
+type forkLayout struct {
+	startBlock uint16
+	numBlocks  uint16
+}
+
+// Close lays out the volume - boot blocks, volume information, allocation
+// block map, file directory and fork data - and writes it to the
+// underlying io.WriteSeeker. The VolumeWriter must not be used afterwards.
+func (vw *VolumeWriter) Close() error {
+	if vw.closed {
+		return errors.New("mfs: volume writer is closed")
+	}
+	vw.closed = true
+
+	allocationBlocks := []uint16{}
+	nextBlock := uint16(2)
+
+	allocate := func(data []byte) forkLayout {
+		if len(data) == 0 {
+			return forkLayout{}
+		}
+
+		numBlocks := uint16((len(data) + writerAllocationBlockSize - 1) / writerAllocationBlockSize)
+		start := nextBlock
+
+		for i := uint16(0); i < numBlocks; i++ {
+			next := chainEnd
+			if i < numBlocks-1 {
+				next = int(nextBlock + 1)
+			}
+			allocationBlocks = append(allocationBlocks, uint16(next))
+			nextBlock++
+		}
+
+		return forkLayout{startBlock: start, numBlocks: numBlocks}
+	}
+
+	dataLayouts := make([]forkLayout, len(vw.files))
+	rsrcLayouts := make([]forkLayout, len(vw.files))
+
+	for i, file := range vw.files {
+		dataLayouts[i] = allocate(file.data)
+		rsrcLayouts[i] = allocate(file.rsrc)
+	}
+
+	// The allocation block map is packed two 12-bit entries per three
+	// bytes; pad with a free block if we ended up with an odd count.
+	if len(allocationBlocks)%2 != 0 {
+		allocationBlocks = append(allocationBlocks, 0)
+	}
+
+	bitmap := packAllocationBlocks(allocationBlocks)
+
+	dirStart := 2 + (volumeInformationSize+len(bitmap)+logicalBlockSize-1)/logicalBlockSize
+
+	directory, err := buildDirectory(vw.files, dataLayouts, rsrcLayouts)
+	if err != nil {
+		return err
+	}
+	blLen := (len(directory) + logicalBlockSize - 1) / logicalBlockSize
+
+	dataAreaOffset := int64(dirStart+blLen) * logicalBlockSize
+	numberOfAllocationBlocks := len(allocationBlocks)
+
+	totalSize := vw.totalSize
+	// Allocation blocks are numbered from 2 and block n starts at
+	// dataAreaOffset + n*writerAllocationBlockSize, so the last one ends
+	// where block numberOfAllocationBlocks+2 would start.
+	if needed := dataAreaOffset + int64(numberOfAllocationBlocks+2)*writerAllocationBlockSize; needed > totalSize {
+		totalSize = needed
+	}
+
+	now := uint32(time.Now().Unix() + macEpochOffset)
+
+	vi := volumeInformation{
+		Signature:                0xd2d7,
+		CreateDate:               now,
+		LastBackup:               0,
+		Attributes:               0,
+		NumberOfFiles:            uint16(len(vw.files)),
+		DirSt:                    uint16(dirStart),
+		BlLen:                    uint16(blLen),
+		NumberOfAllocationBlocks: uint16(numberOfAllocationBlocks),
+		SizeOfAllocationBlocks:   writerAllocationBlockSize,
+		ClpSize:                  writerAllocationBlockSize,
+		NextUnusedFileNumber:     uint32(len(vw.files) + 1),
+		FreeBlocks:               0,
+	}
+	copy(vi.VolumeName[:], pascalBytes(vw.name, maxVolumeNameLength))
+
+	if _, err := vw.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := vw.w.Write(make([]byte, 1024)); err != nil { // boot blocks
+		return err
+	}
+
+	if err := binary.Write(vw.w, binary.BigEndian, &vi); err != nil {
+		return err
+	}
+	if _, err := vw.w.Write(bitmap); err != nil {
+		return err
+	}
+	if _, err := vw.w.Write(make([]byte, int64(dirStart)*logicalBlockSize-(1024+volumeInformationSize+int64(len(bitmap))))); err != nil {
+		return err
+	}
+
+	if _, err := vw.w.Write(directory); err != nil {
+		return err
+	}
+	if pad := int64(blLen)*logicalBlockSize - int64(len(directory)); pad > 0 {
+		if _, err := vw.w.Write(make([]byte, pad)); err != nil {
+			return err
+		}
+	}
+
+	for i, file := range vw.files {
+		if err := vw.writeFork(dataAreaOffset, dataLayouts[i], file.data); err != nil {
+			return err
+		}
+		if err := vw.writeFork(dataAreaOffset, rsrcLayouts[i], file.rsrc); err != nil {
+			return err
+		}
+	}
+
+	if totalSize > 0 {
+		if _, err := vw.w.Seek(totalSize-1, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := vw.w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (vw *VolumeWriter) writeFork(dataAreaOffset int64, layout forkLayout, data []byte) error {
+	if layout.numBlocks == 0 {
+		return nil
+	}
+
+	for i := uint16(0); i < layout.numBlocks; i++ {
+		block := layout.startBlock + i
+		offset := dataAreaOffset + int64(block)*writerAllocationBlockSize
+
+		if _, err := vw.w.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+
+		start := int(i) * writerAllocationBlockSize
+		end := start + writerAllocationBlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		buf := make([]byte, writerAllocationBlockSize)
+		copy(buf, data[start:end])
+
+		if _, err := vw.w.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// packAllocationBlocks packs 12-bit allocation block map entries two at a
+// time into three bytes, the inverse of the unpacking NewVolume performs.
+func packAllocationBlocks(blocks []uint16) []byte {
+	packed := make([]byte, 0, len(blocks)/2*3)
+
+	for i := 0; i < len(blocks); i += 2 {
+		v0, v1 := blocks[i], blocks[i+1]
+		packed = append(packed,
+			byte(v0>>4),
+			byte(((v0&0x0f)<<4)|(v1>>8)),
+			byte(v1&0xff),
+		)
+	}
+
+	return packed
+}
+
+// pascalBytes returns a fixed-size Pascal string buffer (length byte
+// followed by maxLength bytes of content) for name, truncating if needed.
+func pascalBytes(name string, maxLength int) []byte {
+	if len(name) > maxLength {
+		name = name[:maxLength]
+	}
+
+	buf := make([]byte, maxLength+1)
+	buf[0] = byte(len(name))
+	copy(buf[1:], name)
+	return buf
+}
+
+// buildDirectory writes every file's fileDirectoryEntry in the packed,
+// variable-length on-disk format, padding so that no entry straddles a
+// logical block boundary - the same rule NewVolume's reader compensates
+// for when walking the directory.
+func buildDirectory(files []pendingFile, dataLayouts, rsrcLayouts []forkLayout) ([]byte, error) {
+	var buf []byte
+
+	for i, file := range files {
+		entrySize := directoryEntrySize(len(file.name))
+
+		if pos := len(buf) % logicalBlockSize; pos+entrySize > logicalBlockSize {
+			buf = append(buf, make([]byte, logicalBlockSize-pos)...)
+		}
+
+		entry, err := encodeDirectoryEntry(uint32(i+1), file, dataLayouts[i], rsrcLayouts[i])
+		if err != nil {
+			return nil, err
+		}
+
+		buf = append(buf, entry...)
+	}
+
+	return buf, nil
+}
+
+// directoryEntrySize returns the on-disk size of a fileDirectoryEntry with
+// the given file name length, padded to an even number of bytes.
+func directoryEntrySize(nameLength int) int {
+	size := directoryEntryFixedSize + 1 + nameLength
+	if size%2 != 0 {
+		size++
+	}
+	return size
+}
+
+func encodeDirectoryEntry(fileNumber uint32, file pendingFile, dataLayout, rsrcLayout forkLayout) ([]byte, error) {
+	fixed := struct {
+		Flags   byte
+		Version byte
+		UsrWds  [16]byte
+		FlNum   uint32
+		StBlk   uint16
+		LgLen   uint32
+		PyLen   uint32
+		RStBlk  uint16
+		RLgLen  uint32
+		RPyLen  uint32
+		CrDat   uint32
+		MdDat   uint32
+	}{
+		Flags:   0x80, // in use
+		Version: 0,
+		FlNum:   fileNumber,
+		StBlk:   dataLayout.startBlock,
+		LgLen:   uint32(len(file.data)),
+		PyLen:   uint32(dataLayout.numBlocks) * writerAllocationBlockSize,
+		RStBlk:  rsrcLayout.startBlock,
+		RLgLen:  uint32(len(file.rsrc)),
+		RPyLen:  uint32(rsrcLayout.numBlocks) * writerAllocationBlockSize,
+		CrDat:   uint32(file.meta.Created.Unix() + macEpochOffset),
+		MdDat:   uint32(file.meta.Modified.Unix() + macEpochOffset),
+	}
+	copy(fixed.UsrWds[0:4], file.meta.Type)
+	copy(fixed.UsrWds[4:8], file.meta.Creator)
+
+	w := &byteBuffer{}
+	if err := binary.Write(w, binary.BigEndian, &fixed); err != nil {
+		return nil, err
+	}
+	buf := w.buf
+
+	name := pascalBytes(file.name, len(file.name))
+	buf = append(buf, name...)
+
+	if len(buf)%2 != 0 {
+		buf = append(buf, 0)
+	}
+
+	return buf, nil
+}
+
+// byteBuffer is a minimal io.Writer that appends to an in-memory buffer,
+// used so encodeDirectoryEntry can reuse binary.Write for the fixed part of
+// a directory entry.
+type byteBuffer struct {
+	buf []byte
+}
+
+func (b *byteBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
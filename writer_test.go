@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/
+
+package mfs_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/st3fan/mfs"
+)
+
+// memWriteSeeker is a minimal io.WriteSeeker backed by a growable byte
+// slice, for round-tripping a VolumeWriter without touching the disk.
+type memWriteSeeker struct {
+	buf []byte
+	pos int64
+}
+
+func (m *memWriteSeeker) Write(p []byte) (int, error) {
+	if end := m.pos + int64(len(p)); end > int64(len(m.buf)) {
+		m.buf = append(m.buf, make([]byte, end-int64(len(m.buf)))...)
+	}
+	n := copy(m.buf[m.pos:], p)
+	m.pos += int64(n)
+	return n, nil
+}
+
+func (m *memWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		m.pos = offset
+	case io.SeekCurrent:
+		m.pos += offset
+	case io.SeekEnd:
+		m.pos = int64(len(m.buf)) + offset
+	}
+	return m.pos, nil
+}
+
+func Test_CreateAndReopen(t *testing.T) {
+	w := &memWriteSeeker{}
+
+	vw, err := mfs.Create(w, mfs.VolumeOptions{Name: "Test Volume"})
+	if err != nil {
+		t.Fatal("Could not create volume:", err)
+	}
+
+	now := time.Now()
+	meta := mfs.FileMeta{Type: "TEXT", Creator: "ttxt", Created: now, Modified: now}
+
+	if err := vw.AddFile("Hello", meta, bytes.NewReader([]byte("hello world")), bytes.NewReader([]byte("rsrc data"))); err != nil {
+		t.Fatal("Could not add file:", err)
+	}
+
+	if err := vw.Close(); err != nil {
+		t.Fatal("Could not close volume writer:", err)
+	}
+
+	volume, err := mfs.NewVolume(bytes.NewReader(w.buf))
+	if err != nil {
+		t.Fatal("Could not reopen written volume:", err)
+	}
+
+	if volume.Name != "Test Volume" {
+		t.Errorf("Expected volume name %q, got %q", "Test Volume", volume.Name)
+	}
+
+	if len(volume.Files) != 1 {
+		t.Fatalf("Expected 1 file, got %d", len(volume.Files))
+	}
+
+	if volume.Files[0].Name != "Hello" {
+		t.Errorf("Expected file name %q, got %q", "Hello", volume.Files[0].Name)
+	}
+
+	r, err := volume.OpenDataFork(0)
+	if err != nil {
+		t.Fatal("Could not open data fork:", err)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal("Could not read data fork:", err)
+	}
+
+	if string(data) != "hello world" {
+		t.Errorf("Expected data fork %q, got %q", "hello world", string(data))
+	}
+}